@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "migrations"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS group_id`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS migrated_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS dirty`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS applied_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(group_id\), 0\) \+ 1 FROM "migrations"`).WillReturnRows(sqlmock.NewRows([]string{"group_id"}).AddRow(1))
+	mock.ExpectExec(`INSERT INTO "migrations"`).WithArgs("1599691380_a", 1, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{&SimpleMigration{name: "a", date: ti}}
+
+	err = Fake(db, list, "a")
+	assert.NoError(t, err)
+}
+
+func TestForce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`UPDATE "migrations" SET dirty`).WithArgs("1599691380_a", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = Force(db, "1599691380_a", true)
+	assert.NoError(t, err)
+}
+
+func TestForceReverted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`DELETE FROM "migrations"`).WithArgs("1599691380_a").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = Force(db, "1599691380_a", false)
+	assert.NoError(t, err)
+}
+
+func TestForceCustomTableName(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`UPDATE "app_migrations" SET dirty`).WithArgs("1599691380_a", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	m := NewMigrator(WithTableName("app_migrations"))
+	err = m.Force(db, "1599691380_a", true)
+	assert.NoError(t, err)
+}
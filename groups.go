@@ -0,0 +1,119 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//MigrationStatus reports whether a migration has been applied, and if so
+//in which batch and when
+type MigrationStatus struct {
+	Name       string
+	GroupID    int
+	MigratedAt time.Time
+	Applied    bool
+}
+
+//Rollback rolls back every migration in the most recently applied group
+//(the batch inserted together by a single Migrate call), leaving earlier
+//groups untouched. Contiguous runs of migrations sharing the same TxMode
+//are undone together, the same way Migrate applies them (see migrateUpN);
+//a TxNone migration rolls back via DownConn instead of Down. It uses m's
+//configured table name/schema, so it must be constructed with the same
+//options as the Migrator that applied migs. group_id 0 is never treated
+//as a real group: nextGroupID starts real groups at 1, so 0 only ever
+//means "no groups recorded yet" or a legacy row backfilled by
+//checkMigrationTable before groups existed, neither of which Rollback
+//should touch
+func (m *Migrator) Rollback(db *sql.DB, migs MigrationList) error {
+	rows, err := db.Query(fmt.Sprintf(`SELECT migration FROM %s WHERE group_id > 0 AND group_id = (SELECT COALESCE(MAX(group_id), 0) FROM %s WHERE group_id > 0)`, m.table(), m.table()))
+	if err != nil {
+		return err
+	}
+
+	byName := map[string]Migration{}
+	for _, mig := range migs {
+		byName[dbName(mig)] = mig
+	}
+
+	group := MigrationList{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+
+		mig, ok := byName[name]
+		if !ok {
+			rows.Close()
+			return fmt.Errorf("no migration registered for applied migration %s", name)
+		}
+
+		group = append(group, mig)
+	}
+	rows.Close()
+
+	if len(group) == 0 {
+		m.logger.Infof("Nothing to roll back")
+		return nil
+	}
+
+	return m.migrateDownGroup(db, sortMigrations(group))
+}
+
+//Rollback is a convenience wrapper around (*Migrator).Rollback for callers
+//that don't need to configure a table name, schema, or anything besides a
+//logger
+func Rollback(db *sql.DB, log *logrus.Logger, migs MigrationList) error {
+	return NewMigrator(WithLogger(log)).Rollback(db, migs)
+}
+
+//Status reports, for each of the given migrations, whether it has been
+//applied and (if so) which group and when. It uses m's configured table
+//name/schema, so it must be constructed with the same options as the
+//Migrator that applied migs
+func (m *Migrator) Status(ctx context.Context, db *sql.DB, migs MigrationList) ([]MigrationStatus, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT migration, group_id, migrated_at FROM %s`, m.table()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[string]MigrationStatus{}
+	for rows.Next() {
+		var st MigrationStatus
+		if err := rows.Scan(&st.Name, &st.GroupID, &st.MigratedAt); err != nil {
+			return nil, err
+		}
+		st.Applied = true
+		applied[st.Name] = st
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sorted := sortMigrations(migs)
+	statuses := make([]MigrationStatus, 0, len(sorted))
+	for _, mig := range sorted {
+		name := dbName(mig)
+		if st, ok := applied[name]; ok {
+			statuses = append(statuses, st)
+			continue
+		}
+
+		statuses = append(statuses, MigrationStatus{Name: name})
+	}
+
+	return statuses, nil
+}
+
+//Status is a convenience wrapper around (*Migrator).Status for callers
+//that don't need to configure a table name or schema
+func Status(ctx context.Context, db *sql.DB, migs MigrationList) ([]MigrationStatus, error) {
+	return NewMigrator().Status(ctx, db, migs)
+}
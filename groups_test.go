@@ -0,0 +1,187 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE group_id`).WillReturnRows(sqlmock.NewRows([]string{"migration"}).AddRow("1599691380_b"))
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE dirty`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "migrations" SET dirty`).WithArgs("1599691380_b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DROP TABLE posts`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "migrations"`).WithArgs("1599691380_b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		&SimpleMigration{name: "b", date: ti,
+			down: func(tx *sql.Tx) error {
+				_, err := tx.Exec(`DROP TABLE posts`)
+				return err
+			},
+		},
+	}
+
+	err = Rollback(db, logrus.New(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollbackNonTx(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE group_id`).WillReturnRows(sqlmock.NewRows([]string{"migration"}).AddRow("1599691380_a"))
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE dirty`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`UPDATE "migrations" SET dirty`).WithArgs("1599691380_a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DROP INDEX CONCURRENTLY`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "migrations"`).WithArgs("1599691380_a").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		NewNonTxMigration("a", ti,
+			nil,
+			func(ctx context.Context, conn *sql.Conn) error {
+				_, err := conn.ExecContext(ctx, `DROP INDEX CONCURRENTLY idx_users`)
+				return err
+			},
+		),
+	}
+
+	err = Rollback(db, logrus.New(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollbackDirtyBlocksRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE group_id`).WillReturnRows(sqlmock.NewRows([]string{"migration"}).AddRow("1599691380_a"))
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE dirty`).WillReturnRows(sqlmock.NewRows([]string{"migration"}).AddRow("1599691380_a"))
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		&SimpleMigration{name: "a", date: ti},
+	}
+
+	err = Rollback(db, logrus.New(), list)
+	if _, ok := err.(ErrDirty); !ok {
+		t.Fatalf("expected ErrDirty, got %T: %s", err, err)
+	}
+}
+
+//TestRollbackLegacyZeroGroupNoops proves the group_id > 0 guard is present:
+//a database with only legacy migrations backfilled to group_id 0 (by
+//checkMigrationTable, before groups existed) must not have them treated as
+//"the most recently applied group" and rolled back
+func TestRollbackLegacyZeroGroupNoops(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE group_id > 0 AND group_id = \(SELECT COALESCE\(MAX\(group_id\), 0\) FROM "migrations" WHERE group_id > 0\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"migration"}))
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		&SimpleMigration{name: "a", date: ti},
+	}
+
+	err = Rollback(db, logrus.New(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migratedAt := time.Now()
+	mock.ExpectQuery(`SELECT migration, group_id, migrated_at FROM "migrations"`).
+		WillReturnRows(sqlmock.NewRows([]string{"migration", "group_id", "migrated_at"}).AddRow("1599691380_a", 1, migratedAt))
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		&SimpleMigration{name: "a", date: ti},
+		&SimpleMigration{name: "b", date: ti},
+	}
+
+	statuses, err := Status(context.Background(), db, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Applied)
+	assert.Equal(t, 1, statuses[0].GroupID)
+	assert.False(t, statuses[1].Applied)
+}
+
+func TestStatusCustomTableName(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migratedAt := time.Now()
+	mock.ExpectQuery(`SELECT migration, group_id, migrated_at FROM "app_migrations"`).
+		WillReturnRows(sqlmock.NewRows([]string{"migration", "group_id", "migrated_at"}).AddRow("1599691380_a", 1, migratedAt))
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{&SimpleMigration{name: "a", date: ti}}
+
+	m := NewMigrator(WithTableName("app_migrations"))
+	statuses, err := m.Status(context.Background(), db, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, statuses, 1)
+	assert.True(t, statuses[0].Applied)
+}
+
+func TestRollbackCustomTableName(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT migration FROM "app_migrations" WHERE group_id`).WillReturnRows(sqlmock.NewRows([]string{"migration"}).AddRow("1599691380_a"))
+	mock.ExpectQuery(`SELECT migration FROM "app_migrations" WHERE dirty`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "app_migrations" SET dirty`).WithArgs("1599691380_a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "app_migrations"`).WithArgs("1599691380_a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{&SimpleMigration{name: "a", date: ti}}
+
+	m := NewMigrator(WithTableName("app_migrations"), WithLogger(logrus.New()))
+	if err := m.Rollback(db, list); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,129 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+//Locker coordinates exclusive access to a migration run across multiple
+//instances of an application starting concurrently. Lock is called on a
+//dedicated *sql.Conn checked out of the pool so the lock's session survives
+//the *sql.Tx opened for the migration run itself
+type Locker interface {
+	//Lock blocks until an exclusive lock is held on conn, or returns an error
+	Lock(ctx context.Context, conn *sql.Conn) error
+	//Unlock releases a lock previously acquired with Lock
+	Unlock(ctx context.Context, conn *sql.Conn) error
+}
+
+//PostgresLocker acquires a session-level Postgres advisory lock, identified
+//by Key, for the duration of a migration run
+type PostgresLocker struct {
+	Key int64
+}
+
+//Lock acquires the advisory lock, blocking until it is available
+func (p *PostgresLocker) Lock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, p.Key)
+	return err
+}
+
+//Unlock releases the advisory lock
+func (p *PostgresLocker) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, p.Key)
+	return err
+}
+
+//MySQLLocker acquires a named lock via MySQL's GET_LOCK for the duration of
+//a migration run.
+//
+//Only the lock itself is MySQL-specific: checkMigrationTable, migrateUpN
+//and the rest of the bookkeeping this package does around a migration run
+//use Postgres-style "$N" placeholders and aren't yet portable to MySQL's
+//"?" placeholders, so MySQLLocker isn't sufficient on its own to run this
+//package against a MySQL database today
+type MySQLLocker struct {
+	Name string
+	//Timeout bounds how long Lock waits to acquire the named lock before
+	//giving up. Zero (the default) waits indefinitely, matching the Locker
+	//interface's contract
+	Timeout time.Duration
+}
+
+//Lock acquires the named lock, waiting up to Timeout before giving up. A
+//zero Timeout waits indefinitely
+func (m *MySQLLocker) Lock(ctx context.Context, conn *sql.Conn) error {
+	seconds := int64(-1)
+	if m.Timeout > 0 {
+		seconds = int64(m.Timeout / time.Second)
+	}
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, m.Name, seconds).Scan(&acquired); err != nil {
+		return err
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return fmt.Errorf("timed out waiting for lock %q", m.Name)
+	}
+	return nil
+}
+
+//Unlock releases the named lock
+func (m *MySQLLocker) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT RELEASE_LOCK(?)`, m.Name)
+	return err
+}
+
+//checkLockTable creates the migration_locks table if it doesn't exist. It
+//records who is currently holding the migration lock so a stuck lock can be
+//diagnosed (and force-released via ForceUnlock) without guessing
+func (m *Migrator) checkLockTable(db *sql.DB) error {
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		holder      VARCHAR(255) NOT NULL,
+		pid         INTEGER NOT NULL,
+		acquired_at TIMESTAMP NOT NULL
+	)`, m.lockTable()))
+	return err
+}
+
+//recordLockHolder inserts a row identifying the current process as the
+//migration lock holder
+func (m *Migrator) recordLockHolder(db *sql.DB, holder string, pid int, acquiredAt time.Time) error {
+	_, err := db.Exec(fmt.Sprintf(`INSERT INTO %s (holder, pid, acquired_at) VALUES ($1, $2, $3)`, m.lockTable()), holder, pid, acquiredAt)
+	return err
+}
+
+//clearLockHolder removes bookkeeping rows left behind by a migration lock
+func (m *Migrator) clearLockHolder(db *sql.DB) error {
+	_, err := db.Exec(fmt.Sprintf(`DELETE FROM %s`, m.lockTable()))
+	return err
+}
+
+//ForceUnlock releases a migration lock left behind by a crashed or stuck
+//run and clears its migration_locks bookkeeping row. Only call this once
+//you've confirmed no other process genuinely still holds the lock. It uses
+//m's configured table name/schema, so it must be constructed with the same
+//options as the Migrator that normally runs the migration
+func (m *Migrator) ForceUnlock(db *sql.DB, l Locker) error {
+	ctx := m.ctx
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := l.Unlock(ctx, conn); err != nil {
+		return err
+	}
+
+	return m.clearLockHolder(db)
+}
+
+//ForceUnlock is a convenience wrapper around (*Migrator).ForceUnlock for
+//callers that don't need to configure a table name or schema
+func ForceUnlock(db *sql.DB, l Locker) error {
+	return NewMigrator().ForceUnlock(db, l)
+}
@@ -0,0 +1,139 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigratorMigrateWithLocker(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "migration_locks"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SELECT pg_advisory_lock`).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "migration_locks"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "migrations"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS group_id`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS migrated_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS dirty`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS applied_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT migration FROM "migrations"`).WillReturnRows(sqlmock.NewRows([]string{"migration"}))
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE dirty`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`DELETE FROM "migration_locks"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SELECT pg_advisory_unlock`).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	m := NewMigrator(WithLocker(&PostgresLocker{Key: 1}), WithLogger(logrus.New()))
+
+	err = m.Migrate(db, MigrationList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForceUnlock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`SELECT pg_advisory_unlock`).WithArgs(int64(5)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "migration_locks"`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = ForceUnlock(db, &PostgresLocker{Key: 5})
+	assert.NoError(t, err)
+}
+
+func TestMySQLLockerLock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT GET_LOCK\(\?, \?\)`).WithArgs("migrate", int64(5)).WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(1))
+
+	l := &MySQLLocker{Name: "migrate", Timeout: 5 * time.Second}
+	err = l.Lock(context.Background(), conn)
+	assert.NoError(t, err)
+}
+
+func TestMySQLLockerLockZeroTimeoutWaitsIndefinitely(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//a negative timeout tells MySQL's GET_LOCK to wait indefinitely; the
+	//Locker interface's zero-value contract is "blocks until held", not
+	//"returns immediately"
+	mock.ExpectQuery(`SELECT GET_LOCK\(\?, \?\)`).WithArgs("migrate", int64(-1)).WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(1))
+
+	l := &MySQLLocker{Name: "migrate"}
+	err = l.Lock(context.Background(), conn)
+	assert.NoError(t, err)
+}
+
+func TestMySQLLockerLockTimesOut(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT GET_LOCK\(\?, \?\)`).WithArgs("migrate", int64(1)).WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(0))
+
+	l := &MySQLLocker{Name: "migrate", Timeout: time.Second}
+	err = l.Lock(context.Background(), conn)
+	assert.Error(t, err)
+}
+
+func TestMySQLLockerUnlock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`SELECT RELEASE_LOCK\(\?\)`).WithArgs("migrate").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	l := &MySQLLocker{Name: "migrate"}
+	err = l.Unlock(context.Background(), conn)
+	assert.NoError(t, err)
+}
+
+func TestForceUnlockCustomTableName(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec(`SELECT pg_advisory_unlock`).WithArgs(int64(5)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "app_locks"`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	m := NewMigrator(WithTableName("app_migrations"))
+	m.lockTableName = "app_locks"
+
+	err = m.ForceUnlock(db, &PostgresLocker{Key: 5})
+	assert.NoError(t, err)
+}
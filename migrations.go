@@ -24,84 +24,106 @@ func (ml MigrationList) Len() int           { return len(ml) }
 func (ml MigrationList) Swap(i, j int)      { ml[i], ml[j] = ml[j], ml[i] }
 func (ml MigrationList) Less(i, j int) bool { return ml[i].Date().Before(ml[j].Date()) }
 
-//Migrate runs all migration up increments in date order
+//Migrate runs all migration up increments in date order, via a default
+//Migrator constructed from log
 func Migrate(db *sql.DB, log *logrus.Logger, migs []Migration) error {
-	if err := checkMigrationTable(db); err != nil {
-		return err
-	}
-
-	toRun, err := needsToRun(db, migs)
-	if err != nil {
-		return err
-	}
-
-	log.WithField("n", len(toRun)).Infof("Running migrations...")
-
-	return migrateUpN(db, log, toRun, len(toRun))
+	return NewMigrator(WithLogger(log)).Migrate(db, migs)
 }
 
-//migrateUpN runs N up incremenets
-func migrateUpN(db *sql.DB, log *logrus.Logger, migs []Migration, n int) error {
-	tx, err := db.Begin()
-	if err != nil {
+//migrateUpN runs N up increments, recording them all under a single fresh
+//group_id so they can later be rolled back together as a batch. Contiguous
+//runs of migrations sharing the same TxMode (see TransactionModer) are
+//applied together; TxPerMigration/TxNone migrations always run alone
+func (m *Migrator) migrateUpN(db *sql.DB, migs []Migration, n int) error {
+	if err := m.checkDirty(db); err != nil {
 		return err
 	}
 
-	sorted := sortMigrations(migs)
-	for i := 0; i < n; i++ {
-		name := dbName(sorted[i])
+	sorted := sortMigrations(migs)[:n]
 
-		if err := sorted[i].Up(tx); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("Failed to up %s: %s", name, err)
+	var groupID int
+	if n > 0 {
+		var err error
+		if groupID, err = m.nextGroupID(db); err != nil {
+			return err
 		}
+	}
 
-		_, err := tx.Exec(`INSERT INTO migrations VALUES ($1)`, name)
+	for i := 0; i < len(sorted); {
+		run, mode := nextRun(sorted, i)
+
+		var err error
+		switch mode {
+		case TxPerMigration:
+			err = m.runPerMigration(db, run, groupID, i, n)
+		case TxNone:
+			err = m.runNonTx(db, run, groupID, i, n)
+		default:
+			err = m.runBatch(db, run, groupID, i, n)
+		}
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 
-		log.Infof("Up'd %s (%d/%d)", name, i+1, n)
+		i += len(run)
 	}
 
-	return tx.Commit()
+	return nil
 }
 
-//migrateDownN runs N down incremenets
-func migrateDownN(db *sql.DB, log *logrus.Logger, migs []Migration, n int) error {
-	tx, err := db.Begin()
-	if err != nil {
+//migrateDownGroup undoes sorted (a group of already-applied migrations, in
+//date order) in reverse, dispatching contiguous runs through the same
+//TxMode grouping migrateUpN uses for the up direction (see nextRun), so a
+//TxNone migration rolls back via DownConn instead of failing with
+//errNonTxMustUseConn. It refuses to start if any migration is already
+//dirty, same as migrateUpN
+func (m *Migrator) migrateDownGroup(db *sql.DB, sorted MigrationList) error {
+	if err := m.checkDirty(db); err != nil {
 		return err
 	}
 
-	sorted := sortMigrations(migs)
-	for i := len(sorted) - 1; i > len(sorted)-1-n; i-- {
-		name := dbName(sorted[i])
+	type run struct {
+		migs []Migration
+		mode TxMode
+	}
 
-		if err := sorted[i].Down(tx); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("Failed to down %s: %s", name, err)
-		}
+	var runs []run
+	for i := 0; i < len(sorted); {
+		migs, mode := nextRun(sorted, i)
+		runs = append(runs, run{migs, mode})
+		i += len(migs)
+	}
 
-		_, err := tx.Exec(`DELETE FROM migrations WHERE migration = $1`, name)
+	total := len(sorted)
+	done := 0
+	for i := len(runs) - 1; i >= 0; i-- {
+		r := runs[i]
+
+		var err error
+		switch r.mode {
+		case TxPerMigration:
+			err = m.runDownPerMigration(db, r.migs, done, total)
+		case TxNone:
+			err = m.runDownNonTx(db, r.migs, done, total)
+		default:
+			err = m.runDownBatch(db, r.migs, done, total)
+		}
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 
-		log.Infof("Down'd %s (%d/%d)", name, i, n)
+		done += len(r.migs)
 	}
 
-	return tx.Commit()
+	return nil
 }
 
 //needsToRun lists which of the given migrations needs to be run
-func needsToRun(db *sql.DB, migs MigrationList) (MigrationList, error) {
+func (m *Migrator) needsToRun(db *sql.DB, migs MigrationList) (MigrationList, error) {
 	toRun := MigrationList{}
 
 	hasRun := map[string]bool{}
-	hasRunRes, err := db.Query(`SELECT * FROM migrations`)
+	hasRunRes, err := db.Query(fmt.Sprintf(`SELECT migration FROM %s`, m.table()))
 	if err != nil {
 		return nil, err
 	}
@@ -144,8 +166,37 @@ func dbName(mig Migration) string {
 	return migStr[:n]
 }
 
-//checkMigrationTable creates the migrations table if it doesn't exist
-func checkMigrationTable(db *sql.DB) error {
-	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS migrations (migration VARCHAR(500) NOT NULL)`)
-	return err
+//checkMigrationTable creates the migrations table if it doesn't exist, and
+//backfills the group_id/migrated_at columns onto tables created before
+//groups existed
+func (m *Migrator) checkMigrationTable(db *sql.DB) error {
+	table := m.table()
+
+	if _, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		migration   VARCHAR(500) NOT NULL,
+		group_id    INTEGER NOT NULL DEFAULT 0,
+		migrated_at TIMESTAMP NOT NULL DEFAULT now(),
+		dirty       BOOLEAN NOT NULL DEFAULT false,
+		applied_at  TIMESTAMP
+	)`, table)); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS group_id INTEGER NOT NULL DEFAULT 0`, table)); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS migrated_at TIMESTAMP NOT NULL DEFAULT now()`, table)); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS dirty BOOLEAN NOT NULL DEFAULT false`, table)); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS applied_at TIMESTAMP`, table)); err != nil {
+		return err
+	}
+
+	return nil
 }
@@ -57,9 +57,12 @@ func TestMigrateUpN(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE dirty`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(group_id\), 0\) \+ 1 FROM "migrations"`).WillReturnRows(sqlmock.NewRows([]string{"group_id"}).AddRow(1))
 	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "migrations"`).WithArgs("1599691380_a", 1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec(`CREATE users`).WillReturnResult(driver.ResultNoRows)
-	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("1599691380_a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "migrations" SET dirty`).WithArgs("1599691380_a", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
 	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
@@ -72,21 +75,23 @@ func TestMigrateUpN(t *testing.T) {
 		},
 	}
 
-	err = migrateUpN(db, logrus.New(), list, 1)
+	err = NewMigrator(WithLogger(logrus.New())).migrateUpN(db, list, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
-func TestMigrateDownN(t *testing.T) {
+func TestMigrateDownGroup(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE dirty`).WillReturnError(sql.ErrNoRows)
 	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "migrations" SET dirty`).WithArgs("1599691380_a").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec(`DROP TABLE users`).WillReturnResult(driver.ResultNoRows)
-	mock.ExpectExec(`DELETE FROM migrations`).WithArgs("1599691380_a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM "migrations"`).WithArgs("1599691380_a").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
 	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
@@ -99,7 +104,7 @@ func TestMigrateDownN(t *testing.T) {
 		},
 	}
 
-	err = migrateDownN(db, logrus.New(), list, 1)
+	err = NewMigrator(WithLogger(logrus.New())).migrateDownGroup(db, list)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -111,11 +116,18 @@ func TestMigrate(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS migrations`).WillReturnResult(sqlmock.NewResult(0, 1))
-	mock.ExpectQuery(`SELECT \* FROM migrations`).WillReturnRows(sqlmock.NewRows([]string{"migration"}).AddRow("1599691380_a"))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "migrations"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS group_id`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS migrated_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS dirty`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS applied_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT migration FROM "migrations"`).WillReturnRows(sqlmock.NewRows([]string{"migration"}).AddRow("1599691380_a"))
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE dirty`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(group_id\), 0\) \+ 1 FROM "migrations"`).WillReturnRows(sqlmock.NewRows([]string{"group_id"}).AddRow(1))
 	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "migrations"`).WithArgs("1599691380_b", 1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(`DROP TABLE users`).WillReturnResult(sqlmock.NewResult(0, 1))
-	mock.ExpectExec(`INSERT INTO migrations`).WithArgs("1599691380_b").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE "migrations" SET dirty`).WithArgs("1599691380_b", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
 	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
@@ -148,9 +160,16 @@ func TestMigrateRollback(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS migrations`).WillReturnResult(sqlmock.NewResult(0, 1))
-	mock.ExpectQuery(`SELECT \* FROM migrations`).WillReturnRows(sqlmock.NewRows([]string{"migration"}).AddRow("1599691380_a"))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "migrations"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS group_id`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS migrated_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS dirty`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "migrations" ADD COLUMN IF NOT EXISTS applied_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT migration FROM "migrations"`).WillReturnRows(sqlmock.NewRows([]string{"migration"}).AddRow("1599691380_a"))
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE dirty`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(group_id\), 0\) \+ 1 FROM "migrations"`).WillReturnRows(sqlmock.NewRows([]string{"group_id"}).AddRow(1))
 	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "migrations"`).WithArgs("1599691380_b", 1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(`DROP TABLE users`).WillReturnError(errors.New("something like a foreign or similar"))
 	mock.ExpectRollback()
 
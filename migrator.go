@@ -0,0 +1,189 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//Logger is the logging surface a Migrator needs, satisfied by
+//*logrus.Logger without forcing callers that don't otherwise use logrus to
+//depend on it
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+//Migrator runs migrations with behaviour configured via MigratorOption,
+//rather than the fixed behaviour of the package-level Migrate func
+type Migrator struct {
+	tableName     string
+	lockTableName string
+	schema        string
+	logger        Logger
+	ctx           context.Context
+
+	locker      Locker
+	lockTimeout time.Duration
+}
+
+//MigratorOption configures a Migrator
+type MigratorOption func(*Migrator)
+
+//NewMigrator builds a Migrator, applying the given options over sensible
+//defaults (a "migrations"/"migration_locks" table pair in the connection's
+//default schema, logrus's standard logger, context.Background(), no locking)
+func NewMigrator(opts ...MigratorOption) *Migrator {
+	m := &Migrator{
+		tableName:     "migrations",
+		lockTableName: "migration_locks",
+		logger:        logrus.StandardLogger(),
+		ctx:           context.Background(),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+//WithTableName has the Migrator record applied migrations in name instead
+//of the default "migrations" table
+func WithTableName(name string) MigratorOption {
+	return func(m *Migrator) { m.tableName = name }
+}
+
+//WithSchema has the Migrator qualify its migrations/migration_locks tables
+//with schema instead of relying on the connection's default schema
+func WithSchema(schema string) MigratorOption {
+	return func(m *Migrator) { m.schema = schema }
+}
+
+//WithLogger has the Migrator report progress via l instead of logrus's
+//standard logger
+func WithLogger(l Logger) MigratorOption {
+	return func(m *Migrator) { m.logger = l }
+}
+
+//WithContext has the Migrator use ctx for the context-aware portions of a
+//migration run (acquiring and releasing its Locker, ForceUnlock, and
+//running TxNone migrations on a dedicated connection) instead of
+//context.Background()
+func WithContext(ctx context.Context) MigratorOption {
+	return func(m *Migrator) { m.ctx = ctx }
+}
+
+//WithLocker has the Migrator hold l for the duration of the migration run,
+//so multiple instances starting concurrently don't race to apply the same
+//migrations
+func WithLocker(l Locker) MigratorOption {
+	return func(m *Migrator) { m.locker = l }
+}
+
+//WithLockTimeout bounds how long the Migrator will wait to acquire its
+//Locker before giving up. Zero (the default) waits indefinitely
+func WithLockTimeout(d time.Duration) MigratorOption {
+	return func(m *Migrator) { m.lockTimeout = d }
+}
+
+//quoteIdent double-quotes an identifier so a configured table/schema name
+//can never be interpreted as anything but a single identifier, however it
+//was spelled
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+//qualify quotes name and, if a schema was configured, prefixes it with the
+//quoted schema
+func (m *Migrator) qualify(name string) string {
+	if m.schema != "" {
+		return quoteIdent(m.schema) + "." + quoteIdent(name)
+	}
+	return quoteIdent(name)
+}
+
+//table returns the schema-qualified, quoted migrations table identifier
+func (m *Migrator) table() string {
+	return m.qualify(m.tableName)
+}
+
+//lockTable returns the schema-qualified, quoted migration_locks table
+//identifier
+func (m *Migrator) lockTable() string {
+	return m.qualify(m.lockTableName)
+}
+
+//Migrate runs all migration up increments in date order, holding m's
+//Locker (if any) for the duration of the run
+func (m *Migrator) Migrate(db *sql.DB, migs []Migration) error {
+	if m.locker != nil {
+		unlock, err := m.acquireLock(db)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	if err := m.checkMigrationTable(db); err != nil {
+		return err
+	}
+
+	toRun, err := m.needsToRun(db, migs)
+	if err != nil {
+		return err
+	}
+
+	m.logger.Infof("Running %d migrations...", len(toRun))
+
+	return m.migrateUpN(db, toRun, len(toRun))
+}
+
+//acquireLock checks out a dedicated connection and holds it for the
+//migration run's duration, so the session-scoped lock isn't released by an
+//unrelated *sql.Tx finishing. It returns a func that releases the lock and
+//the connection; callers must defer it whether or not the migration run
+//ultimately succeeds
+func (m *Migrator) acquireLock(db *sql.DB) (func(), error) {
+	ctx := m.ctx
+
+	if err := m.checkLockTable(db); err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lockCtx := ctx
+	if m.lockTimeout > 0 {
+		var cancel context.CancelFunc
+		lockCtx, cancel = context.WithTimeout(ctx, m.lockTimeout)
+		defer cancel()
+	}
+
+	if err := m.locker.Lock(lockCtx, conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to acquire migration lock: %s", err)
+	}
+
+	hostname, _ := os.Hostname()
+	if err := m.recordLockHolder(db, hostname, os.Getpid(), time.Now()); err != nil {
+		m.locker.Unlock(ctx, conn)
+		conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		m.clearLockHolder(db)
+		m.locker.Unlock(ctx, conn)
+		conn.Close()
+	}, nil
+}
@@ -0,0 +1,94 @@
+package pgx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{&SimpleMigration{name: "a", date: ti}}
+
+	err := Fake(ctx, conn, list, list[0].Name())
+	assert.NoError(t, err)
+
+	var count int
+	err = conn.QueryRow(ctx, `SELECT count(*) FROM migrations WHERE migration = $1 AND NOT dirty`, dbName(list[0])).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, count)
+}
+
+func TestForce(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{&SimpleMigration{name: "a", date: ti}}
+
+	if err := Fake(ctx, conn, list, list[0].Name()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, `UPDATE migrations SET dirty = true WHERE migration = $1`, dbName(list[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Force(ctx, conn, dbName(list[0]), true)
+	assert.NoError(t, err)
+
+	var dirty bool
+	err = conn.QueryRow(ctx, `SELECT dirty FROM migrations WHERE migration = $1`, dbName(list[0])).Scan(&dirty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, dirty)
+}
+
+func TestForceReverted(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{&SimpleMigration{name: "a", date: ti}}
+
+	if err := Fake(ctx, conn, list, list[0].Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Force(ctx, conn, dbName(list[0]), false)
+	assert.NoError(t, err)
+
+	var count int
+	err = conn.QueryRow(ctx, `SELECT count(*) FROM migrations WHERE migration = $1`, dbName(list[0])).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count)
+}
+
+func TestFakeCustomTableName(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{&SimpleMigration{name: "a", date: ti}}
+
+	m := NewMigrator(WithTableName("app_migrations"), WithLocker(nil))
+	if err := m.Fake(ctx, conn, list, list[0].Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	err := conn.QueryRow(ctx, `SELECT count(*) FROM app_migrations WHERE migration = $1`, dbName(list[0])).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, count)
+}
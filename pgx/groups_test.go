@@ -0,0 +1,159 @@
+package pgx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollback(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		&SimpleMigration{name: "b", date: ti,
+			up: func(ctx context.Context, tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `CREATE TABLE posts (id int)`)
+				return err
+			},
+			down: func(ctx context.Context, tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `DROP TABLE posts`)
+				return err
+			},
+		},
+	}
+
+	if err := NewMigrator().Migrate(ctx, conn, list); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Rollback(ctx, conn, logrus.New(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	err = conn.QueryRow(ctx, `SELECT count(*) FROM migrations`).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count, "rolled back migration's row should be removed")
+}
+
+func TestRollbackNonTx(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		NewNonTxMigration("a", ti,
+			func(ctx context.Context, conn *pgx.Conn) error {
+				_, err := conn.Exec(ctx, `CREATE INDEX CONCURRENTLY idx_users ON users (id)`)
+				return err
+			},
+			func(ctx context.Context, conn *pgx.Conn) error {
+				_, err := conn.Exec(ctx, `DROP INDEX CONCURRENTLY idx_users`)
+				return err
+			},
+		),
+	}
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE users (id int)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewMigrator().Migrate(ctx, conn, list); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Rollback(ctx, conn, logrus.New(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollbackDirtyBlocksRollback(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		&SimpleMigration{name: "a", date: ti},
+	}
+
+	if err := NewMigrator().Migrate(ctx, conn, list); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, `UPDATE migrations SET dirty = true WHERE migration = $1`, dbName(list[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Rollback(ctx, conn, logrus.New(), list)
+	if _, ok := err.(ErrDirty); !ok {
+		t.Fatalf("expected ErrDirty, got %T: %s", err, err)
+	}
+}
+
+//TestRollbackLegacyZeroGroupNoops proves a database with only legacy
+//migrations backfilled to group_id 0 (by checkMigrationTable, before groups
+//existed) doesn't have them treated as "the most recently applied group"
+//and rolled back
+func TestRollbackLegacyZeroGroupNoops(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		&SimpleMigration{name: "a", date: ti},
+	}
+
+	m := NewMigrator(WithLocker(nil))
+	if err := m.checkMigrationTable(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, `INSERT INTO migrations (migration, group_id, migrated_at, dirty) VALUES ($1, 0, now(), false)`, dbName(list[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Rollback(ctx, conn, logrus.New(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	err = conn.QueryRow(ctx, `SELECT count(*) FROM migrations WHERE migration = $1`, dbName(list[0])).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, count, "legacy group_id 0 row should not be rolled back")
+}
+
+func TestStatus(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		&SimpleMigration{name: "a", date: ti},
+		&SimpleMigration{name: "b", date: ti.Add(time.Second)},
+	}
+
+	if err := NewMigrator().Migrate(ctx, conn, list[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := Status(ctx, conn, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Applied)
+	assert.Equal(t, 1, statuses[0].GroupID)
+	assert.False(t, statuses[1].Applied)
+}
@@ -0,0 +1,97 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//Locker coordinates exclusive access to a migration run across multiple
+//instances of an application starting concurrently
+type Locker interface {
+	//Lock blocks until an exclusive lock is held on conn, or returns an error
+	Lock(ctx context.Context, conn *pgx.Conn) error
+	//Unlock releases a lock previously acquired with Lock
+	Unlock(ctx context.Context, conn *pgx.Conn) error
+}
+
+//PostgresLocker acquires a session-level Postgres advisory lock, identified
+//by Key, for the duration of a migration run
+type PostgresLocker struct {
+	Key int64
+}
+
+//Lock acquires the advisory lock, blocking until it is available
+func (p *PostgresLocker) Lock(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, p.Key)
+	return err
+}
+
+//Unlock releases the advisory lock
+func (p *PostgresLocker) Unlock(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, p.Key)
+	return err
+}
+
+//lockKey derives a stable advisory lock key from the migrations table name,
+//so multiple tools/tables in the same database don't contend on each other
+func lockKey(tableName string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(tableName))
+	return int64(h.Sum64())
+}
+
+//checkLockTable creates the migration_locks table if it doesn't exist. It
+//records who is currently holding the migration lock so a stuck lock can be
+//diagnosed (and force-released via ForceUnlock) without guessing
+func (m *Migrator) checkLockTable(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		holder      VARCHAR(255) NOT NULL,
+		pid         INTEGER NOT NULL,
+		acquired_at TIMESTAMPTZ NOT NULL
+	)`, m.lockTable()))
+	return err
+}
+
+//recordLockHolder inserts a row identifying the current process as the
+//migration lock holder
+func (m *Migrator) recordLockHolder(ctx context.Context, conn *pgx.Conn, holder string, pid int, acquiredAt time.Time) error {
+	_, err := conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (holder, pid, acquired_at) VALUES ($1, $2, $3)`, m.lockTable()), holder, pid, acquiredAt)
+	return err
+}
+
+//clearLockHolder removes bookkeeping rows left behind by a migration lock
+func (m *Migrator) clearLockHolder(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, fmt.Sprintf(`DELETE FROM %s`, m.lockTable()))
+	return err
+}
+
+//ForceUnlock releases a migration lock left behind by a crashed or stuck
+//run and clears its migration_locks bookkeeping row. Only call this once
+//you've confirmed no other process genuinely still holds the lock. It uses
+//m's configured table name/schema, so it must be constructed with the same
+//options as the Migrator that normally runs the migration
+func (m *Migrator) ForceUnlock(ctx context.Context, conn *pgx.Conn) error {
+	locker := &PostgresLocker{Key: lockKey(m.tableName)}
+
+	if err := locker.Unlock(ctx, conn); err != nil {
+		return err
+	}
+
+	return m.clearLockHolder(ctx, conn)
+}
+
+//ForceUnlock is a convenience wrapper around (*Migrator).ForceUnlock for
+//callers that don't need to configure a schema
+func ForceUnlock(ctx context.Context, conn *pgx.Conn, tableName string) error {
+	return NewMigrator(WithTableName(tableName)).ForceUnlock(ctx, conn)
+}
+
+func currentHolder() (string, int) {
+	hostname, _ := os.Hostname()
+	return hostname, os.Getpid()
+}
@@ -0,0 +1,80 @@
+package pgx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigratorMigrateWithLocker(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	err := NewMigrator(WithLocker(&PostgresLocker{Key: 1})).Migrate(ctx, conn, MigrationList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	err = conn.QueryRow(ctx, `SELECT count(*) FROM migration_locks`).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count, "lock bookkeeping should be cleared once the run finishes")
+}
+
+func TestForceUnlock(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	locker := &PostgresLocker{Key: lockKey(defaultTableName)}
+	if err := NewMigrator(WithLocker(locker)).checkLockTable(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := locker.Lock(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewMigrator(WithLocker(locker)).recordLockHolder(ctx, conn, "host", 1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ForceUnlock(ctx, conn, defaultTableName)
+	assert.NoError(t, err)
+
+	var count int
+	err = conn.QueryRow(ctx, `SELECT count(*) FROM migration_locks`).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count)
+}
+
+func TestForceUnlockWithSchema(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	m := NewMigrator(WithSchema("public"))
+
+	locker := &PostgresLocker{Key: lockKey(defaultTableName)}
+	if err := m.checkLockTable(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := locker.Lock(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.recordLockHolder(ctx, conn, "host", 1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.ForceUnlock(ctx, conn)
+	assert.NoError(t, err)
+
+	var count int
+	err = conn.QueryRow(ctx, `SELECT count(*) FROM migration_locks`).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count, "ForceUnlock should clear the schema-qualified lock table")
+}
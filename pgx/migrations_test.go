@@ -0,0 +1,116 @@
+package pgx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDbName(t *testing.T) {
+	d, err := time.Parse(time.RFC3339, "2020-09-09T20:52:05+10:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mig := &SimpleMigration{name: "b", date: d}
+	name := dbName(mig)
+
+	assert.Equal(t, "1599648725_b", name)
+}
+
+func TestTruncatedDbName(t *testing.T) {
+	d, err := time.Parse(time.RFC3339, "2020-09-09T20:52:05+10:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	longName := ""
+	for i := 0; i < 100; i++ {
+		longName += "abcdefghijklmnopqrstuwxyz"
+	}
+
+	mig := &SimpleMigration{name: longName, date: d}
+	name := dbName(mig)
+
+	assert.Equal(t, ("1599648725_" + longName)[:500], name)
+}
+
+func TestSortMigrations(t *testing.T) {
+	list := MigrationList{
+		&SimpleMigration{name: "a", date: time.Now().Add(5 * time.Second)},
+		&SimpleMigration{name: "b", date: time.Now()},
+	}
+	sorted := sortMigrations(list)
+
+	assert.Equal(t, "b", sorted[0].Name())
+	assert.Equal(t, "a", sorted[1].Name())
+}
+
+func TestMigrateUpN(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		&SimpleMigration{name: "a", date: ti,
+			up: func(ctx context.Context, tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `CREATE TABLE users (id int)`)
+				return err
+			},
+		},
+	}
+
+	m := NewMigrator(WithLocker(nil))
+	if err := m.checkMigrationTable(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.migrateUpN(ctx, conn, list, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	err := conn.QueryRow(ctx, `SELECT count(*) FROM migrations WHERE migration = $1 AND NOT dirty`, dbName(list[0])).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, count)
+}
+
+func TestMigrateDownGroup(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		&SimpleMigration{name: "a", date: ti,
+			up: func(ctx context.Context, tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `CREATE TABLE users (id int)`)
+				return err
+			},
+			down: func(ctx context.Context, tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, `DROP TABLE users`)
+				return err
+			},
+		},
+	}
+
+	m := NewMigrator(WithLocker(nil))
+	if err := m.checkMigrationTable(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.migrateUpN(ctx, conn, list, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.migrateDownGroup(ctx, conn, sortMigrations(list)); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	err := conn.QueryRow(ctx, `SELECT count(*) FROM migrations WHERE migration = $1`, dbName(list[0])).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,169 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/sirupsen/logrus"
+)
+
+//defaultTableName is the migrations table used when a Migrator isn't given
+//WithTableName
+const defaultTableName = "migrations"
+
+//defaultLockTableName is the migration_locks table a Migrator records its
+//lock holder in; WithTableName does not change it
+const defaultLockTableName = "migration_locks"
+
+//Logger is the logging surface a Migrator needs, satisfied by
+//*logrus.Logger without forcing callers that don't otherwise use logrus to
+//depend on it
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+//Migrator runs migrations with behaviour configured via MigratorOption,
+//rather than the fixed behaviour of the package-level Migrate func. Unlike
+//the generic migrate package, locking defaults on: a session-level Postgres
+//advisory lock keyed off the migrations table name is held for the
+//duration of the run unless locking is disabled with WithLocker(nil)
+type Migrator struct {
+	tableName     string
+	lockTableName string
+	schema        string
+	logger        Logger
+
+	locker      Locker
+	lockTimeout time.Duration
+	noLock      bool
+}
+
+//MigratorOption configures a Migrator
+type MigratorOption func(*Migrator)
+
+//NewMigrator builds a Migrator, applying the given options over sensible
+//defaults (advisory locking on the default table name, logrus's standard
+//logger)
+func NewMigrator(opts ...MigratorOption) *Migrator {
+	m := &Migrator{
+		tableName:     defaultTableName,
+		lockTableName: defaultLockTableName,
+		logger:        logrus.StandardLogger(),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.locker == nil && !m.noLock {
+		m.locker = &PostgresLocker{Key: lockKey(m.tableName)}
+	}
+
+	return m
+}
+
+//WithTableName has the Migrator record applied migrations in name instead
+//of the default "migrations" table
+func WithTableName(name string) MigratorOption {
+	return func(m *Migrator) { m.tableName = name }
+}
+
+//WithSchema has the Migrator qualify its migrations/migration_locks tables
+//with schema instead of relying on the connection's default schema
+func WithSchema(schema string) MigratorOption {
+	return func(m *Migrator) { m.schema = schema }
+}
+
+//WithLogger has the Migrator report progress via l instead of logrus's
+//standard logger
+func WithLogger(l Logger) MigratorOption {
+	return func(m *Migrator) { m.logger = l }
+}
+
+//WithLocker overrides the Migrator's default PostgresLocker. Passing nil
+//disables locking entirely
+func WithLocker(l Locker) MigratorOption {
+	return func(m *Migrator) {
+		m.locker = l
+		m.noLock = l == nil
+	}
+}
+
+//WithLockTimeout bounds how long the Migrator will wait to acquire its
+//lock before giving up. Zero (the default) waits indefinitely
+func WithLockTimeout(d time.Duration) MigratorOption {
+	return func(m *Migrator) { m.lockTimeout = d }
+}
+
+//quoteIdent double-quotes an identifier so a configured table/schema name
+//can never be interpreted as anything but a single identifier, however it
+//was spelled
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+//qualify quotes name and, if a schema was configured, prefixes it with the
+//quoted schema
+func (m *Migrator) qualify(name string) string {
+	if m.schema != "" {
+		return quoteIdent(m.schema) + "." + quoteIdent(name)
+	}
+	return quoteIdent(name)
+}
+
+//table returns the schema-qualified, quoted migrations table identifier
+func (m *Migrator) table() string {
+	return m.qualify(m.tableName)
+}
+
+//lockTable returns the schema-qualified, quoted migration_locks table
+//identifier
+func (m *Migrator) lockTable() string {
+	return m.qualify(m.lockTableName)
+}
+
+//Migrate runs all migration up increments in date order, holding m's
+//advisory lock (if any) for the duration of the run
+func (m *Migrator) Migrate(ctx context.Context, db *pgx.Conn, migs []Migration) error {
+	if m.locker != nil {
+		if err := m.checkLockTable(ctx, db); err != nil {
+			return err
+		}
+
+		lockCtx := ctx
+		if m.lockTimeout > 0 {
+			var cancel context.CancelFunc
+			lockCtx, cancel = context.WithTimeout(ctx, m.lockTimeout)
+			defer cancel()
+		}
+
+		if err := m.locker.Lock(lockCtx, db); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %s", err)
+		}
+		defer m.locker.Unlock(ctx, db)
+
+		holder, pid := currentHolder()
+		if err := m.recordLockHolder(ctx, db, holder, pid, time.Now()); err != nil {
+			return err
+		}
+		defer m.clearLockHolder(ctx, db)
+	}
+
+	if err := m.checkMigrationTable(ctx, db); err != nil {
+		return err
+	}
+
+	toRun, err := m.needsToRun(ctx, db, migs)
+	if err != nil {
+		return err
+	}
+
+	m.logger.Infof("Running %d migrations...", len(toRun))
+
+	return m.migrateUpN(ctx, db, toRun, len(toRun))
+}
@@ -0,0 +1,52 @@
+package pgx
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//testConn connects to the Postgres instance named by PGX_MIGRATE_TEST_DSN,
+//skipping the test when it isn't set. The package's Migrator talks to
+//*pgx.Conn directly (not an interface), so exercising it needs a real
+//connection rather than a mock
+func testConn(t *testing.T) *pgx.Conn {
+	t.Helper()
+
+	dsn := os.Getenv("PGX_MIGRATE_TEST_DSN")
+	if dsn == "" {
+		t.Skip("PGX_MIGRATE_TEST_DSN not set; skipping test that needs a real Postgres connection")
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connecting to %s: %s", dsn, err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close(ctx)
+	})
+
+	dropTestTables(t, conn)
+	t.Cleanup(func() {
+		dropTestTables(t, conn)
+	})
+
+	return conn
+}
+
+//dropTestTables removes the tables this package's tests create, so a
+//previous run's leftovers (or one test's tables) can't bleed into another
+func dropTestTables(t *testing.T, conn *pgx.Conn) {
+	t.Helper()
+
+	ctx := context.Background()
+	for _, table := range []string{"migrations", "migration_locks", "app_migrations", "users", "posts"} {
+		if _, err := conn.Exec(ctx, `DROP TABLE IF EXISTS `+table); err != nil {
+			t.Fatalf("dropping %s: %s", table, err)
+		}
+	}
+}
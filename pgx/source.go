@@ -0,0 +1,112 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//fileMigration is a Migration sourced from one or two SQL files on an fs.FS
+type fileMigration struct {
+	name string
+	date time.Time
+
+	upStmts   []string
+	downStmts []string
+}
+
+//Up runs each statement parsed from the migration's up file/section in order
+func (fm *fileMigration) Up(ctx context.Context, tx pgx.Tx) error {
+	return execStmts(ctx, tx, fm.upStmts)
+}
+
+//Down runs each statement parsed from the migration's down file/section in order
+func (fm *fileMigration) Down(ctx context.Context, tx pgx.Tx) error {
+	return execStmts(ctx, tx, fm.downStmts)
+}
+
+//Date which the migration was created (not applied)
+func (fm *fileMigration) Date() time.Time { return fm.date }
+
+//Name provides a human readable name
+func (fm *fileMigration) Name() string { return fm.name }
+
+func execStmts(ctx context.Context, tx pgx.Tx, stmts []string) error {
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//FromFS discovers migrations from an fs.FS (e.g. embed.FS) rooted at dir,
+//parsing files named like 20200910084300_create_users.up.sql /
+//20200910084300_create_users.down.sql, or the combined
+//20200910084300_create_users.sql using "-- +migrate Up" / "-- +migrate Down"
+//section markers. A "-- +migrate StatementBegin" / "-- +migrate StatementEnd"
+//pair can wrap a single statement containing semicolons (e.g. a function or
+//trigger body), as popularised by rubenv/sql-migrate.
+func FromFS(fsys fs.FS, dir string) (MigrationList, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*fileMigration{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileNameExp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		date, err := time.Parse(fileNameTimeLayout, match[1])
+		if err != nil {
+			return nil, fmt.Errorf("pgx: invalid timestamp in %s: %s", entry.Name(), err)
+		}
+		name, direction := match[2], match[3]
+
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byName[name]
+		if !ok {
+			mig = &fileMigration{name: name, date: date}
+			byName[name] = mig
+		}
+
+		switch direction {
+		case "up":
+			if mig.upStmts, err = splitStatements(string(contents)); err != nil {
+				return nil, fmt.Errorf("pgx: %s: %s", entry.Name(), err)
+			}
+		case "down":
+			if mig.downStmts, err = splitStatements(string(contents)); err != nil {
+				return nil, fmt.Errorf("pgx: %s: %s", entry.Name(), err)
+			}
+		default:
+			if mig.upStmts, mig.downStmts, err = splitMigrationSQL(string(contents)); err != nil {
+				return nil, fmt.Errorf("pgx: %s: %s", entry.Name(), err)
+			}
+		}
+	}
+
+	migs := make(MigrationList, 0, len(byName))
+	for _, mig := range byName {
+		migs = append(migs, mig)
+	}
+
+	return migs, nil
+}
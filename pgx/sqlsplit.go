@@ -0,0 +1,128 @@
+package pgx
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//fileNameExp matches migration file names such as
+//20200910084300_create_users.up.sql / .down.sql, as well as the combined
+//form 20200910084300_create_users.sql
+var fileNameExp = regexp.MustCompile(`^(\d{14})_(.+?)(?:\.(up|down))?\.sql$`)
+
+//fileNameTimeLayout is the timestamp format embedded in migration file names
+const fileNameTimeLayout = "20060102150405"
+
+const (
+	markerUp             = "-- +migrate Up"
+	markerDown           = "-- +migrate Down"
+	markerStatementBegin = "-- +migrate StatementBegin"
+	markerStatementEnd   = "-- +migrate StatementEnd"
+)
+
+//splitMigrationSQL splits a combined SQL file into its up and down statement
+//lists using "-- +migrate Up" / "-- +migrate Down" section markers
+func splitMigrationSQL(content string) (up, down []string, err error) {
+	var section *[]string
+	var stmt strings.Builder
+	inBlock := false
+
+	flush := func() {
+		if section == nil {
+			return
+		}
+		if s := strings.TrimSpace(stmt.String()); s != "" {
+			*section = append(*section, s)
+		}
+		stmt.Reset()
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch trimmed {
+		case markerUp:
+			flush()
+			section = &up
+			continue
+		case markerDown:
+			flush()
+			section = &down
+			continue
+		case markerStatementBegin:
+			inBlock = true
+			continue
+		case markerStatementEnd:
+			inBlock = false
+			flush()
+			continue
+		}
+
+		if section == nil {
+			if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+				continue
+			}
+			return nil, nil, fmt.Errorf("statement found before %q marker", markerUp)
+		}
+
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	flush()
+
+	return up, down, scanner.Err()
+}
+
+//splitStatements splits a single-direction SQL file into individual
+//statements, honouring "-- +migrate StatementBegin" / "StatementEnd" blocks
+//for statements that contain semicolons of their own
+func splitStatements(content string) ([]string, error) {
+	var stmts []string
+	var stmt strings.Builder
+	inBlock := false
+
+	flush := func() {
+		if s := strings.TrimSpace(stmt.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		stmt.Reset()
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch trimmed {
+		case markerStatementBegin:
+			inBlock = true
+			continue
+		case markerStatementEnd:
+			inBlock = false
+			flush()
+			continue
+		}
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	flush()
+
+	return stmts, scanner.Err()
+}
@@ -0,0 +1,60 @@
+package pgx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestMigrateUpNNonTx(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE users (id int)`); err != nil {
+		t.Fatal(err)
+	}
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		NewNonTxMigration("a", ti,
+			func(ctx context.Context, conn *pgx.Conn) error {
+				_, err := conn.Exec(ctx, `CREATE INDEX CONCURRENTLY idx_users ON users (id)`)
+				return err
+			},
+			nil,
+		),
+	}
+
+	m := NewMigrator(WithLocker(nil))
+	if err := m.checkMigrationTable(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.migrateUpN(ctx, conn, list, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateUpNDirtyBlocksNextRun(t *testing.T) {
+	conn := testConn(t)
+	ctx := context.Background()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		NewNonTxMigration("a", ti, nil, nil),
+	}
+
+	m := NewMigrator(WithLocker(nil))
+	if err := m.checkMigrationTable(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, `INSERT INTO migrations (migration, group_id, migrated_at, dirty) VALUES ($1, 1, now(), true)`, dbName(list[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.migrateUpN(ctx, conn, list, 1)
+	if _, ok := err.(ErrDirty); !ok {
+		t.Fatalf("expected ErrDirty, got %T: %s", err, err)
+	}
+}
@@ -0,0 +1,337 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func errNonTxMustUseConn(name string) error {
+	return fmt.Errorf("%s must be run via UpConn/DownConn, not Up/Down", name)
+}
+
+//ErrDirty indicates name was left partially applied by a previous run (it
+//failed, or the process died, somewhere between Up/Down starting and the
+//migration being marked clean). Fix the database by hand, then call Force
+//to clear the dirty flag before migrating again
+type ErrDirty struct {
+	Name string
+}
+
+func (e ErrDirty) Error() string {
+	return fmt.Sprintf("migration %s is dirty: a previous run left it partially applied; fix it by hand and call Force to clear it", e.Name)
+}
+
+//checkDirty refuses to proceed if any migration is currently marked dirty
+func (m *Migrator) checkDirty(ctx context.Context, conn *pgx.Conn) error {
+	var name string
+	err := conn.QueryRow(ctx, fmt.Sprintf(`SELECT migration FROM %s WHERE dirty LIMIT 1`, m.table())).Scan(&name)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrDirty{Name: name}
+}
+
+//nextGroupID returns the group_id the next applied batch of migrations
+//should be recorded under
+func (m *Migrator) nextGroupID(ctx context.Context, conn *pgx.Conn) (int, error) {
+	var groupID int
+	err := conn.QueryRow(ctx, fmt.Sprintf(`SELECT COALESCE(MAX(group_id), 0) + 1 FROM %s`, m.table())).Scan(&groupID)
+	return groupID, err
+}
+
+//Fake records name (a Migration.Name(), looked up in migs) as applied
+//without running it, useful when adopting the tool on an existing schema.
+//It uses m's configured table name/schema, so it must be constructed with
+//the same options as the Migrator that normally runs migs
+func (m *Migrator) Fake(ctx context.Context, conn *pgx.Conn, migs MigrationList, name string) error {
+	var mig Migration
+	for _, candidate := range migs {
+		if candidate.Name() == name {
+			mig = candidate
+			break
+		}
+	}
+	if mig == nil {
+		return fmt.Errorf("no migration registered with name %s", name)
+	}
+
+	if err := m.checkMigrationTable(ctx, conn); err != nil {
+		return err
+	}
+
+	groupID, err := m.nextGroupID(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (migration, group_id, migrated_at, dirty, applied_at) VALUES ($1, $2, $3, false, $4)`, m.table()), dbName(mig), groupID, now, now)
+	return err
+}
+
+//Fake is a convenience wrapper around (*Migrator).Fake for callers that
+//don't need to configure a table name or schema
+func Fake(ctx context.Context, conn *pgx.Conn, migs MigrationList, name string) error {
+	return NewMigrator().Fake(ctx, conn, migs, name)
+}
+
+//Force resets the dirty flag left behind by a failed or interrupted run,
+//once the operator has fixed the database up by hand. Pass applied=true if
+//the migration's effects are now in place (it's marked clean, applied),
+//or applied=false if they were rolled back by hand (its migrations row is
+//removed so it will be picked up again on the next run). It uses m's
+//configured table name/schema, so it must be constructed with the same
+//options as the Migrator that normally runs the migration
+func (m *Migrator) Force(ctx context.Context, conn *pgx.Conn, name string, applied bool) error {
+	table := m.table()
+
+	if !applied {
+		_, err := conn.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE migration = $1`, table), name)
+		return err
+	}
+
+	_, err := conn.Exec(ctx, fmt.Sprintf(`UPDATE %s SET dirty = false, applied_at = $2 WHERE migration = $1`, table), name, time.Now())
+	return err
+}
+
+//Force is a convenience wrapper around (*Migrator).Force for callers that
+//don't need to configure a table name or schema
+func Force(ctx context.Context, conn *pgx.Conn, name string, applied bool) error {
+	return NewMigrator().Force(ctx, conn, name, applied)
+}
+
+//nextRun returns the contiguous slice of sorted starting at i that should
+//run as a single unit: a run of consecutive TxBatch migrations, or a lone
+//TxPerMigration/TxNone migration
+func nextRun(sorted []Migration, i int) ([]Migration, TxMode) {
+	mode := txModeOf(sorted[i])
+	if mode != TxBatch {
+		return sorted[i : i+1], mode
+	}
+
+	j := i + 1
+	for j < len(sorted) && txModeOf(sorted[j]) == TxBatch {
+		j++
+	}
+	return sorted[i:j], mode
+}
+
+//runBatch applies run inside a single shared transaction. Each migration's
+//row is inserted dirty before Up runs and cleared after it succeeds
+func (m *Migrator) runBatch(ctx context.Context, conn *pgx.Conn, run []Migration, groupID, offset, total int) error {
+	table := m.table()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	for k, mig := range run {
+		name := dbName(mig)
+
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (migration, group_id, migrated_at, dirty) VALUES ($1, $2, $3, true)`, table), name, groupID, time.Now()); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+
+		if err := mig.Up(ctx, tx); err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("Failed to up %s: %s", name, err)
+		}
+
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET dirty = false, applied_at = $2 WHERE migration = $1`, table), name, time.Now()); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+
+		m.logger.Infof("Up'd %s (%d/%d)", name, offset+k+1, total)
+	}
+
+	return tx.Commit(ctx)
+}
+
+//runPerMigration applies the single migration in run inside its own
+//transaction
+func (m *Migrator) runPerMigration(ctx context.Context, conn *pgx.Conn, run []Migration, groupID, offset, total int) error {
+	table := m.table()
+
+	mig := run[0]
+	name := dbName(mig)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (migration, group_id, migrated_at, dirty) VALUES ($1, $2, $3, true)`, table), name, groupID, time.Now()); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := mig.Up(ctx, tx); err != nil {
+		tx.Rollback(ctx)
+		return fmt.Errorf("Failed to up %s: %s", name, err)
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET dirty = false, applied_at = $2 WHERE migration = $1`, table), name, time.Now()); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	m.logger.Infof("Up'd %s (%d/%d)", name, offset+1, total)
+	return nil
+}
+
+//runDownBatch undoes run (in reverse order) inside a single shared
+//transaction. Each migration's row is marked dirty before Down runs and
+//removed once it succeeds
+func (m *Migrator) runDownBatch(ctx context.Context, conn *pgx.Conn, run []Migration, done, total int) error {
+	table := m.table()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	for k := len(run) - 1; k >= 0; k-- {
+		mig := run[k]
+		name := dbName(mig)
+
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET dirty = true WHERE migration = $1`, table), name); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+
+		if err := mig.Down(ctx, tx); err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("Failed to down %s: %s", name, err)
+		}
+
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE migration = $1`, table), name); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+
+		m.logger.Infof("Down'd %s (%d/%d)", name, done+(len(run)-k), total)
+	}
+
+	return tx.Commit(ctx)
+}
+
+//runDownPerMigration undoes the single migration in run inside its own
+//transaction
+func (m *Migrator) runDownPerMigration(ctx context.Context, conn *pgx.Conn, run []Migration, done, total int) error {
+	table := m.table()
+
+	mig := run[0]
+	name := dbName(mig)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET dirty = true WHERE migration = $1`, table), name); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := mig.Down(ctx, tx); err != nil {
+		tx.Rollback(ctx)
+		return fmt.Errorf("Failed to down %s: %s", name, err)
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE migration = $1`, table), name); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	m.logger.Infof("Down'd %s (%d/%d)", name, done+1, total)
+	return nil
+}
+
+//runDownNonTx undoes the single TxNone migration in run directly against
+//conn, outside any transaction, via DownConn. Its row is marked dirty
+//before DownConn runs; a failure leaves that dirty row in place so the
+//next run refuses to proceed (ErrDirty) until the operator calls Force
+func (m *Migrator) runDownNonTx(ctx context.Context, conn *pgx.Conn, run []Migration, done, total int) error {
+	table := m.table()
+
+	mig := run[0]
+	name := dbName(mig)
+
+	cm, ok := mig.(ConnMigration)
+	if !ok {
+		return fmt.Errorf("%s declares TxNone but doesn't implement ConnMigration", name)
+	}
+
+	if _, err := conn.Exec(ctx, fmt.Sprintf(`UPDATE %s SET dirty = true WHERE migration = $1`, table), name); err != nil {
+		return err
+	}
+
+	if err := cm.DownConn(ctx, conn); err != nil {
+		return fmt.Errorf("Failed to down %s: %s (database left dirty; fix it by hand, then clear it with Force)", name, err)
+	}
+
+	if _, err := conn.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE migration = $1`, table), name); err != nil {
+		return err
+	}
+
+	m.logger.Infof("Down'd %s (%d/%d)", name, done+1, total)
+	return nil
+}
+
+//runNonTx applies the single TxNone migration in run directly against conn,
+//outside any transaction. Its row is recorded dirty before UpConn runs; a
+//failure leaves that dirty row in place so the next run refuses to proceed
+//(ErrDirty) until the operator calls Force
+func (m *Migrator) runNonTx(ctx context.Context, conn *pgx.Conn, run []Migration, groupID, offset, total int) error {
+	table := m.table()
+
+	mig := run[0]
+	name := dbName(mig)
+
+	cm, ok := mig.(ConnMigration)
+	if !ok {
+		return fmt.Errorf("%s declares TxNone but doesn't implement ConnMigration", name)
+	}
+
+	if _, err := conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (migration, group_id, migrated_at, dirty) VALUES ($1, $2, $3, true)`, table), name, groupID, time.Now()); err != nil {
+		return err
+	}
+
+	if err := cm.UpConn(ctx, conn); err != nil {
+		return fmt.Errorf("Failed to up %s: %s (database left dirty; fix it by hand, then clear it with Force)", name, err)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET dirty = false, applied_at = $2 WHERE migration = $1`, table), name, time.Now()); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	m.logger.Infof("Up'd %s (%d/%d)", name, offset+1, total)
+	return nil
+}
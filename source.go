@@ -0,0 +1,229 @@
+package migrate
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//fileNameExp matches migration file names such as
+//20200910084300_create_users.up.sql / .down.sql, as well as the combined
+//form 20200910084300_create_users.sql
+var fileNameExp = regexp.MustCompile(`^(\d{14})_(.+?)(?:\.(up|down))?\.sql$`)
+
+//fileNameTimeLayout is the timestamp format embedded in migration file names
+const fileNameTimeLayout = "20060102150405"
+
+const (
+	markerUp             = "-- +migrate Up"
+	markerDown           = "-- +migrate Down"
+	markerStatementBegin = "-- +migrate StatementBegin"
+	markerStatementEnd   = "-- +migrate StatementEnd"
+)
+
+//fileMigration is a Migration sourced from one or two SQL files on an fs.FS
+type fileMigration struct {
+	name string
+	date time.Time
+
+	upStmts   []string
+	downStmts []string
+}
+
+//Up runs each statement parsed from the migration's up file/section in order
+func (fm *fileMigration) Up(tx *sql.Tx) error { return execStmts(tx, fm.upStmts) }
+
+//Down runs each statement parsed from the migration's down file/section in order
+func (fm *fileMigration) Down(tx *sql.Tx) error { return execStmts(tx, fm.downStmts) }
+
+//Date which the migration was created (not applied)
+func (fm *fileMigration) Date() time.Time { return fm.date }
+
+//Name provides a human readable name
+func (fm *fileMigration) Name() string { return fm.name }
+
+func execStmts(tx *sql.Tx, stmts []string) error {
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//FromFS discovers migrations from an fs.FS (e.g. embed.FS) rooted at dir,
+//parsing files named like 20200910084300_create_users.up.sql /
+//20200910084300_create_users.down.sql, or the combined
+//20200910084300_create_users.sql using "-- +migrate Up" / "-- +migrate Down"
+//section markers. A "-- +migrate StatementBegin" / "-- +migrate StatementEnd"
+//pair can wrap a single statement containing semicolons (e.g. a function or
+//trigger body), as popularised by rubenv/sql-migrate.
+func FromFS(fsys fs.FS, dir string) (MigrationList, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*fileMigration{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileNameExp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		date, err := time.Parse(fileNameTimeLayout, match[1])
+		if err != nil {
+			return nil, fmt.Errorf("migrate: invalid timestamp in %s: %s", entry.Name(), err)
+		}
+		name, direction := match[2], match[3]
+
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byName[name]
+		if !ok {
+			mig = &fileMigration{name: name, date: date}
+			byName[name] = mig
+		}
+
+		switch direction {
+		case "up":
+			if mig.upStmts, err = splitStatements(string(contents)); err != nil {
+				return nil, fmt.Errorf("migrate: %s: %s", entry.Name(), err)
+			}
+		case "down":
+			if mig.downStmts, err = splitStatements(string(contents)); err != nil {
+				return nil, fmt.Errorf("migrate: %s: %s", entry.Name(), err)
+			}
+		default:
+			if mig.upStmts, mig.downStmts, err = splitMigrationSQL(string(contents)); err != nil {
+				return nil, fmt.Errorf("migrate: %s: %s", entry.Name(), err)
+			}
+		}
+	}
+
+	migs := make(MigrationList, 0, len(byName))
+	for _, mig := range byName {
+		migs = append(migs, mig)
+	}
+
+	return migs, nil
+}
+
+//splitMigrationSQL splits a combined SQL file into its up and down statement
+//lists using "-- +migrate Up" / "-- +migrate Down" section markers
+func splitMigrationSQL(content string) (up, down []string, err error) {
+	var section *[]string
+	var stmt strings.Builder
+	inBlock := false
+
+	flush := func() {
+		if section == nil {
+			return
+		}
+		if s := strings.TrimSpace(stmt.String()); s != "" {
+			*section = append(*section, s)
+		}
+		stmt.Reset()
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch trimmed {
+		case markerUp:
+			flush()
+			section = &up
+			continue
+		case markerDown:
+			flush()
+			section = &down
+			continue
+		case markerStatementBegin:
+			inBlock = true
+			continue
+		case markerStatementEnd:
+			inBlock = false
+			flush()
+			continue
+		}
+
+		if section == nil {
+			if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+				continue
+			}
+			return nil, nil, fmt.Errorf("statement found before %q marker", markerUp)
+		}
+
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	flush()
+
+	return up, down, scanner.Err()
+}
+
+//splitStatements splits a single-direction SQL file into individual
+//statements, honouring "-- +migrate StatementBegin" / "StatementEnd" blocks
+//for statements that contain semicolons of their own
+func splitStatements(content string) ([]string, error) {
+	var stmts []string
+	var stmt strings.Builder
+	inBlock := false
+
+	flush := func() {
+		if s := strings.TrimSpace(stmt.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		stmt.Reset()
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch trimmed {
+		case markerStatementBegin:
+			inBlock = true
+			continue
+		case markerStatementEnd:
+			inBlock = false
+			flush()
+			continue
+		}
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	flush()
+
+	return stmts, scanner.Err()
+}
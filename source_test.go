@@ -0,0 +1,79 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	sql := `
+CREATE TABLE users (id int);
+
+-- +migrate StatementBegin
+CREATE FUNCTION do_thing() RETURNS void AS $$
+BEGIN
+	INSERT INTO users (id) VALUES (1);
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+CREATE INDEX idx_users ON users (id);
+`
+
+	stmts, err := splitStatements(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, stmts, 3)
+	assert.Contains(t, stmts[1], "BEGIN")
+}
+
+func TestSplitMigrationSQL(t *testing.T) {
+	sql := `-- +migrate Up
+CREATE TABLE users (id int);
+
+-- +migrate Down
+DROP TABLE users;
+`
+
+	up, down, err := splitMigrationSQL(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"CREATE TABLE users (id int);"}, up)
+	assert.Equal(t, []string{"DROP TABLE users;"}, down)
+}
+
+func TestSplitMigrationSQLMissingMarker(t *testing.T) {
+	_, _, err := splitMigrationSQL("CREATE TABLE users (id int);")
+	assert.Error(t, err)
+}
+
+func TestFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20200910084300_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id int);")},
+		"migrations/20200910084300_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"migrations/20200911000000_combined.sql": {Data: []byte(
+			"-- +migrate Up\nCREATE TABLE posts (id int);\n\n-- +migrate Down\nDROP TABLE posts;\n",
+		)},
+	}
+
+	migs, err := FromFS(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sorted := sortMigrations(migs)
+	assert.Len(t, sorted, 2)
+
+	assert.Equal(t, "create_users", sorted[0].Name())
+	ti, _ := time.Parse(fileNameTimeLayout, "20200910084300")
+	assert.Equal(t, ti, sorted[0].Date())
+
+	assert.Equal(t, "combined", sorted[1].Name())
+}
@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+//TxMode controls how much of a transaction a migration runs within
+type TxMode int
+
+const (
+	//TxBatch runs a contiguous run of migrations inside a single shared
+	//transaction (the default for migrations that don't opt into another mode)
+	TxBatch TxMode = iota
+	//TxPerMigration opens a fresh transaction for just this migration
+	TxPerMigration
+	//TxNone runs the migration directly against the connection, outside any
+	//transaction, for DDL that Postgres refuses to run inside one (e.g.
+	//CREATE INDEX CONCURRENTLY, ALTER TYPE ... ADD VALUE)
+	TxNone
+)
+
+//TransactionModer lets a Migration opt into a transaction granularity other
+//than TxBatch by implementing TransactionMode
+type TransactionModer interface {
+	TransactionMode() TxMode
+}
+
+//txModeOf returns mig's declared TxMode, defaulting to TxBatch
+func txModeOf(mig Migration) TxMode {
+	if tm, ok := mig.(TransactionModer); ok {
+		return tm.TransactionMode()
+	}
+	return TxBatch
+}
+
+//ConnIncrement applies an increment directly to a connection, outside any
+//transaction
+type ConnIncrement func(ctx context.Context, conn *sql.Conn) error
+
+//ConnMigration is implemented by migrations whose Up/Down must run directly
+//against a *sql.Conn rather than inside a *sql.Tx, such as those created
+//with NewNonTxMigration
+type ConnMigration interface {
+	Migration
+	UpConn(ctx context.Context, conn *sql.Conn) error
+	DownConn(ctx context.Context, conn *sql.Conn) error
+}
+
+//NonTxMigration is a Migration that always runs outside a transaction
+type NonTxMigration struct {
+	name string
+	date time.Time
+
+	up   ConnIncrement
+	down ConnIncrement
+}
+
+//NewNonTxMigration declares a migration whose Up/Down run directly against
+//a *sql.Conn instead of a *sql.Tx, for DDL that cannot run inside a
+//transaction
+func NewNonTxMigration(name string, date time.Time, up, down ConnIncrement) *NonTxMigration {
+	return &NonTxMigration{name: name, date: date, up: up, down: down}
+}
+
+//TransactionMode always reports TxNone
+func (nm *NonTxMigration) TransactionMode() TxMode { return TxNone }
+
+//Date which the migration was created (not applied)
+func (nm *NonTxMigration) Date() time.Time { return nm.date }
+
+//Name provides a human readable name
+func (nm *NonTxMigration) Name() string { return nm.name }
+
+//Up is never called: TxNone migrations are run via UpConn against a bare
+//connection instead. It exists only so NonTxMigration satisfies Migration
+func (nm *NonTxMigration) Up(tx *sql.Tx) error { return errNonTxMustUseConn(nm.name) }
+
+//Down is never called: TxNone migrations are run via DownConn against a
+//bare connection instead. It exists only so NonTxMigration satisfies Migration
+func (nm *NonTxMigration) Down(tx *sql.Tx) error { return errNonTxMustUseConn(nm.name) }
+
+//UpConn runs the apply increment directly against conn
+func (nm *NonTxMigration) UpConn(ctx context.Context, conn *sql.Conn) error {
+	if nm.up != nil {
+		return nm.up(ctx, conn)
+	}
+	return nil
+}
+
+//DownConn runs the rollback decrement directly against conn
+func (nm *NonTxMigration) DownConn(ctx context.Context, conn *sql.Conn) error {
+	if nm.down != nil {
+		return nm.down(ctx, conn)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMigrateUpNNonTx(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE dirty`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(group_id\), 0\) \+ 1 FROM "migrations"`).WillReturnRows(sqlmock.NewRows([]string{"group_id"}).AddRow(1))
+	mock.ExpectExec(`INSERT INTO "migrations"`).WithArgs("1599691380_a", 1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`CREATE INDEX CONCURRENTLY`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "migrations" SET dirty`).WithArgs("1599691380_a", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		NewNonTxMigration("a", ti,
+			func(ctx context.Context, conn *sql.Conn) error {
+				_, err := conn.ExecContext(ctx, `CREATE INDEX CONCURRENTLY idx_users ON users (id)`)
+				return err
+			},
+			nil,
+		),
+	}
+
+	if err := NewMigrator(WithLogger(logrus.New())).migrateUpN(db, list, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateUpNDirtyBlocksNextRun(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(`SELECT migration FROM "migrations" WHERE dirty`).WillReturnRows(sqlmock.NewRows([]string{"migration"}).AddRow("1599691380_a"))
+
+	ti, _ := time.Parse(time.RFC3339, "2020-09-10T08:43:00+10:00")
+	list := MigrationList{
+		NewNonTxMigration("a", ti, nil, nil),
+	}
+
+	err = NewMigrator(WithLogger(logrus.New())).migrateUpN(db, list, 1)
+	if err == nil {
+		t.Fatal("expected an error for a dirty migration")
+	}
+
+	if _, ok := err.(ErrDirty); !ok {
+		t.Fatalf("expected ErrDirty, got %T: %s", err, err)
+	}
+}
@@ -0,0 +1,354 @@
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func errNonTxMustUseConn(name string) error {
+	return fmt.Errorf("%s must be run via UpConn/DownConn, not Up/Down", name)
+}
+
+//ErrDirty indicates name was left partially applied by a previous run (it
+//failed, or the process died, somewhere between Up/Down starting and the
+//migration being marked clean). Fix the database by hand, then call Force
+//to clear the dirty flag before migrating again
+type ErrDirty struct {
+	Name string
+}
+
+func (e ErrDirty) Error() string {
+	return fmt.Sprintf("migration %s is dirty: a previous run left it partially applied; fix it by hand and call Force to clear it", e.Name)
+}
+
+//checkDirty refuses to proceed if any migration is currently marked dirty
+func (m *Migrator) checkDirty(db *sql.DB) error {
+	var name string
+	err := db.QueryRow(fmt.Sprintf(`SELECT migration FROM %s WHERE dirty LIMIT 1`, m.table())).Scan(&name)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrDirty{Name: name}
+}
+
+//nextGroupID returns the group_id the next applied batch of migrations
+//should be recorded under
+func (m *Migrator) nextGroupID(db *sql.DB) (int, error) {
+	var groupID int
+	err := db.QueryRow(fmt.Sprintf(`SELECT COALESCE(MAX(group_id), 0) + 1 FROM %s`, m.table())).Scan(&groupID)
+	return groupID, err
+}
+
+//Fake records name (a Migration.Name(), looked up in migs) as applied
+//without running it, useful when adopting the tool on an existing schema.
+//It uses m's configured table name/schema, so it must be constructed with
+//the same options as the Migrator that normally runs migs
+func (m *Migrator) Fake(db *sql.DB, migs MigrationList, name string) error {
+	var mig Migration
+	for _, candidate := range migs {
+		if candidate.Name() == name {
+			mig = candidate
+			break
+		}
+	}
+	if mig == nil {
+		return fmt.Errorf("no migration registered with name %s", name)
+	}
+
+	if err := m.checkMigrationTable(db); err != nil {
+		return err
+	}
+
+	groupID, err := m.nextGroupID(db)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = db.Exec(fmt.Sprintf(`INSERT INTO %s (migration, group_id, migrated_at, dirty, applied_at) VALUES ($1, $2, $3, false, $4)`, m.table()), dbName(mig), groupID, now, now)
+	return err
+}
+
+//Fake is a convenience wrapper around (*Migrator).Fake for callers that
+//don't need to configure a table name, schema, or logger
+func Fake(db *sql.DB, migs MigrationList, name string) error {
+	return NewMigrator().Fake(db, migs, name)
+}
+
+//Force resets the dirty flag left behind by a failed or interrupted run,
+//once the operator has fixed the database up by hand. Pass applied=true if
+//the migration's effects are now in place (it's marked clean, applied),
+//or applied=false if they were rolled back by hand (its migrations row is
+//removed so it will be picked up again on the next run). It uses m's
+//configured table name/schema, so it must be constructed with the same
+//options as the Migrator that normally runs the migration
+func (m *Migrator) Force(db *sql.DB, name string, applied bool) error {
+	table := m.table()
+
+	if !applied {
+		_, err := db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE migration = $1`, table), name)
+		return err
+	}
+
+	_, err := db.Exec(fmt.Sprintf(`UPDATE %s SET dirty = false, applied_at = $2 WHERE migration = $1`, table), name, time.Now())
+	return err
+}
+
+//Force is a convenience wrapper around (*Migrator).Force for callers that
+//don't need to configure a table name or schema
+func Force(db *sql.DB, name string, applied bool) error {
+	return NewMigrator().Force(db, name, applied)
+}
+
+//nextRun returns the contiguous slice of sorted starting at i that should
+//run as a single unit: a run of consecutive TxBatch migrations, or a lone
+//TxPerMigration/TxNone migration
+func nextRun(sorted []Migration, i int) ([]Migration, TxMode) {
+	mode := txModeOf(sorted[i])
+	if mode != TxBatch {
+		return sorted[i : i+1], mode
+	}
+
+	j := i + 1
+	for j < len(sorted) && txModeOf(sorted[j]) == TxBatch {
+		j++
+	}
+	return sorted[i:j], mode
+}
+
+//runBatch applies run inside a single shared transaction. Each migration's
+//row is inserted dirty before Up runs and cleared after it succeeds. The
+//dirty rows are written inside the same transaction, so a failure rolls
+//them back along with everything else and leaves nothing for checkDirty
+func (m *Migrator) runBatch(db *sql.DB, run []Migration, groupID, offset, total int) error {
+	table := m.table()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for k, mig := range run {
+		name := dbName(mig)
+
+		if _, err := tx.Exec(fmt.Sprintf(`INSERT INTO %s (migration, group_id, migrated_at, dirty) VALUES ($1, $2, $3, true)`, table), name, groupID, time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := mig.Up(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to up %s: %s", name, err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET dirty = false, applied_at = $2 WHERE migration = $1`, table), name, time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		m.logger.Infof("Up'd %s (%d/%d)", name, offset+k+1, total)
+	}
+
+	return tx.Commit()
+}
+
+//runPerMigration applies the single migration in run inside its own
+//transaction
+func (m *Migrator) runPerMigration(db *sql.DB, run []Migration, groupID, offset, total int) error {
+	table := m.table()
+
+	mig := run[0]
+	name := dbName(mig)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`INSERT INTO %s (migration, group_id, migrated_at, dirty) VALUES ($1, $2, $3, true)`, table), name, groupID, time.Now()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := mig.Up(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to up %s: %s", name, err)
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET dirty = false, applied_at = $2 WHERE migration = $1`, table), name, time.Now()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	m.logger.Infof("Up'd %s (%d/%d)", name, offset+1, total)
+	return nil
+}
+
+//runDownBatch undoes run (in reverse order) inside a single shared
+//transaction. Each migration's row is marked dirty before Down runs and
+//removed once it succeeds. The dirty flags are set inside the same
+//transaction, so a failure rolls them back along with everything else and
+//leaves nothing for checkDirty
+func (m *Migrator) runDownBatch(db *sql.DB, run []Migration, done, total int) error {
+	table := m.table()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for k := len(run) - 1; k >= 0; k-- {
+		mig := run[k]
+		name := dbName(mig)
+
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET dirty = true WHERE migration = $1`, table), name); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := mig.Down(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to down %s: %s", name, err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE migration = $1`, table), name); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		m.logger.Infof("Down'd %s (%d/%d)", name, done+(len(run)-k), total)
+	}
+
+	return tx.Commit()
+}
+
+//runDownPerMigration undoes the single migration in run inside its own
+//transaction
+func (m *Migrator) runDownPerMigration(db *sql.DB, run []Migration, done, total int) error {
+	table := m.table()
+
+	mig := run[0]
+	name := dbName(mig)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET dirty = true WHERE migration = $1`, table), name); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := mig.Down(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Failed to down %s: %s", name, err)
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE migration = $1`, table), name); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	m.logger.Infof("Down'd %s (%d/%d)", name, done+1, total)
+	return nil
+}
+
+//runDownNonTx undoes the single TxNone migration in run directly against a
+//dedicated connection, outside any transaction, via DownConn. Its row is
+//marked dirty before DownConn runs; a failure leaves that dirty row in
+//place so the next run refuses to proceed (ErrDirty) until the operator
+//calls Force
+func (m *Migrator) runDownNonTx(db *sql.DB, run []Migration, done, total int) error {
+	table := m.table()
+
+	mig := run[0]
+	name := dbName(mig)
+
+	cm, ok := mig.(ConnMigration)
+	if !ok {
+		return fmt.Errorf("%s declares TxNone but doesn't implement ConnMigration", name)
+	}
+
+	ctx := m.ctx
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET dirty = true WHERE migration = $1`, table), name); err != nil {
+		return err
+	}
+
+	if err := cm.DownConn(ctx, conn); err != nil {
+		return fmt.Errorf("Failed to down %s: %s (database left dirty; fix it by hand, then clear it with Force)", name, err)
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE migration = $1`, table), name); err != nil {
+		return err
+	}
+
+	m.logger.Infof("Down'd %s (%d/%d)", name, done+1, total)
+	return nil
+}
+
+//runNonTx applies the single TxNone migration in run directly against a
+//dedicated connection, outside any transaction. Its row is recorded dirty
+//before UpConn runs; a failure leaves that dirty row in place so the next
+//run refuses to proceed (ErrDirty) until the operator calls Force
+func (m *Migrator) runNonTx(db *sql.DB, run []Migration, groupID, offset, total int) error {
+	table := m.table()
+
+	mig := run[0]
+	name := dbName(mig)
+
+	cm, ok := mig.(ConnMigration)
+	if !ok {
+		return fmt.Errorf("%s declares TxNone but doesn't implement ConnMigration", name)
+	}
+
+	ctx := m.ctx
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (migration, group_id, migrated_at, dirty) VALUES ($1, $2, $3, true)`, table), name, groupID, time.Now()); err != nil {
+		return err
+	}
+
+	if err := cm.UpConn(ctx, conn); err != nil {
+		return fmt.Errorf("Failed to up %s: %s (database left dirty; fix it by hand, then clear it with Force)", name, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET dirty = false, applied_at = $2 WHERE migration = $1`, table), name, time.Now()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	m.logger.Infof("Up'd %s (%d/%d)", name, offset+1, total)
+	return nil
+}